@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"golang.zx2c4.com/wireguard/wgctrl"
+)
+
+// runOnce performs a single check-and-enforce cycle across all configured
+// failover groups: it fetches the current peers, decides which peer in each
+// group should be active, and pushes that state to OPNsense. It returns the
+// first error encountered instead of terminating the process, so callers
+// (daemon mode in particular) can retry on the next tick.
+func runOnce(config Config) error {
+	key, secret, err := resolveCredentials(config)
+	if err != nil {
+		return fmt.Errorf("resolving API credentials: %w", err)
+	}
+	encodedAuth := base64.StdEncoding.EncodeToString([]byte(key + ":" + secret))
+
+	httpClient, err := newHTTPClient(config.CACertFile, config.CertPinSHA256)
+	if err != nil {
+		return fmt.Errorf("configuring http client: %w", err)
+	}
+
+	allPeers, err := getPeers(httpClient, encodedAuth, config.FirewallUrl)
+	if err != nil {
+		return fmt.Errorf("getting peers: %w", err)
+	}
+
+	// Get wireguard server details as we'll need the uuid of them when setting the peer
+	serverDetails, err := getServerDetails(httpClient, encodedAuth, config.FirewallUrl)
+	if err != nil {
+		return fmt.Errorf("getting server details: %w", err)
+	}
+
+	wgClient, err := wgctrl.New()
+	if err != nil {
+		return fmt.Errorf("opening wgctrl client: %w", err)
+	}
+	defer wgClient.Close()
+
+	statePath := config.StateFile
+	if statePath == "" {
+		statePath = defaultStateFile
+	}
+
+	state, err := loadState(statePath)
+	if err != nil {
+		return fmt.Errorf("loading state: %w", err)
+	}
+
+	now := time.Now()
+	anyChanged := false
+
+	// Each server is an independent failover group: find the wanted peers for
+	// it, debounce each one's raw liveness through its hysteresis counters,
+	// work out which one (if any) should be active, then enable that one and
+	// disable the rest - but only where OPNsense doesn't already agree.
+	for _, server := range config.Servers {
+		slog.Info("evaluating failover group", "server", server.ServerName)
+
+		wantedPeers, err := getWantedPeers(allPeers, server.ServerName)
+		if err != nil {
+			return fmt.Errorf("parsing peers for %s: %w", server.ServerName, err)
+		}
+
+		handshakeWindow := defaultHandshakeWindow
+		if server.HandshakeWindowSeconds > 0 {
+			handshakeWindow = time.Duration(server.HandshakeWindowSeconds) * time.Second
+		}
+		minDwell := time.Duration(server.MinDwellSeconds) * time.Second
+
+		upByUUID := map[string]bool{}
+		for _, v := range wantedPeers {
+			rawUp := isPeerUp(wgClient, server.Interface, handshakeWindow, v)
+			ps := state.peer(v.Uuid)
+			previouslyUp := ps.LastObservedUp
+			debouncedUp := ps.observe(rawUp, server.RequiredConsecutiveUp, server.RequiredConsecutiveDown, minDwell, now)
+			upByUUID[v.Uuid] = debouncedUp
+
+			if debouncedUp != previouslyUp {
+				notifyStateChange(config.Notifications, NotificationEvent{
+					Peer:          v.Name,
+					Server:        server.ServerName,
+					Endpoint:      v.Serveraddress,
+					PreviousState: upDownLabel(previouslyUp),
+					NewState:      upDownLabel(debouncedUp),
+					Timestamp:     now,
+				})
+			}
+		}
+
+		activePeer, found := selectActivePeer(wantedPeers, server.PeerPriority, upByUUID)
+
+		for _, v := range wantedPeers {
+			desiredEnabled := found && v.Uuid == activePeer.Uuid
+			recordPeerUp(server.ServerName, v.Name, desiredEnabled)
+
+			ps := state.peer(v.Uuid)
+			if desiredEnabled == (v.Enabled == "1") {
+				ps.LastAppliedEnabled = desiredEnabled
+				continue
+			}
+
+			if err := setPeer(httpClient, desiredEnabled, encodedAuth, config.FirewallUrl, v, serverDetails); err != nil {
+				notifyStateChange(config.Notifications, NotificationEvent{
+					Peer:          v.Name,
+					Server:        server.ServerName,
+					Endpoint:      v.Serveraddress,
+					PreviousState: upDownLabel(v.Enabled == "1"),
+					NewState:      upDownLabel(desiredEnabled),
+					Timestamp:     now,
+					Error:         err.Error(),
+				})
+				_ = state.save(statePath)
+				return fmt.Errorf("setting peer %s: %w", v.Name, err)
+			}
+
+			ps.LastAppliedEnabled = desiredEnabled
+			anyChanged = true
+		}
+	}
+
+	if err := state.save(statePath); err != nil {
+		return fmt.Errorf("saving state: %w", err)
+	}
+
+	// Apply changes - only push these when a peer actually changed, so a
+	// daemon on a steady-state tunnel isn't POSTing config-apply endpoints to
+	// the firewall every tick.
+	if anyChanged {
+		wireguardSetUrl := "/api/wireguard/general/set"
+		wireguardSetBody := []byte(`{"general": { "enabled": "1"}}`)
+		if _, _, err := makeRequest(httpClient, "POST", config.FirewallUrl+wireguardSetUrl, encodedAuth, bytes.NewBuffer(wireguardSetBody)); err != nil {
+			return fmt.Errorf("enabling wireguard: %w", err)
+		}
+
+		wireguardReconfigureUrl := "/api/wireguard/service/reconfigure"
+		if _, _, err := makeRequest(httpClient, "POST", config.FirewallUrl+wireguardReconfigureUrl, encodedAuth, nil); err != nil {
+			return fmt.Errorf("reconfiguring wireguard: %w", err)
+		}
+	} else {
+		slog.Info("no peer state changed, skipping general/set and reconfigure")
+	}
+
+	lastCheckTimestamp.Set(float64(time.Now().Unix()))
+	return nil
+}
+
+// runDaemon runs check cycles on a fixed interval until the process is
+// killed, serving Prometheus metrics and a health check over HTTP alongside
+// it. Unlike one-shot mode, a failed check cycle is logged and retried on the
+// next tick rather than being fatal.
+func runDaemon(config Config, interval time.Duration, metricsAddr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metricsHandler())
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("ok"))
+	})
+
+	server := &http.Server{Addr: metricsAddr, Handler: mux}
+	go func() {
+		slog.Info("metrics server listening", "addr", metricsAddr)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("metrics server stopped unexpectedly", "err", err)
+		}
+	}()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := runOnce(config); err != nil {
+			slog.Error("check cycle failed, will retry next tick", "err", err)
+		}
+
+		<-ticker.C
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// loadAPIKey reads Key/Secret from an OPNsense-issued apikey.txt file (lines
+// of the form "key = ..." and "secret = ...") instead of inlining them in
+// config.json.
+func loadAPIKey(path string) (key string, secret string, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", "", err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		name, value, ok := strings.Cut(scanner.Text(), "=")
+		if !ok {
+			continue
+		}
+
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "key":
+			key = strings.TrimSpace(value)
+		case "secret":
+			secret = strings.TrimSpace(value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", "", err
+	}
+
+	if key == "" || secret == "" {
+		return "", "", fmt.Errorf("%s: missing key or secret", path)
+	}
+
+	return key, secret, nil
+}
+
+// resolveCredentials returns the API key/secret to use: from config.ApiKeyFile
+// if set, otherwise the inline config.Key/config.Secret.
+func resolveCredentials(config Config) (key string, secret string, err error) {
+	if config.ApiKeyFile != "" {
+		return loadAPIKey(config.ApiKeyFile)
+	}
+
+	return config.Key, config.Secret, nil
+}
+
+// newHTTPClient builds the client used for all OPNsense API calls, optionally
+// trusting a private CA bundle and/or pinning the firewall's certificate by
+// its SHA-256 fingerprint.
+func newHTTPClient(caCertFile string, pinSHA256 string) (*http.Client, error) {
+	tlsConfig := &tls.Config{}
+
+	if caCertFile != "" {
+		pem, err := os.ReadFile(caCertFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading CA bundle: %w", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", caCertFile)
+		}
+
+		tlsConfig.RootCAs = pool
+	}
+
+	if pinSHA256 != "" {
+		want := strings.ToLower(strings.ReplaceAll(pinSHA256, ":", ""))
+
+		tlsConfig.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			return checkCertPin(rawCerts, want)
+		}
+
+		if caCertFile == "" {
+			// Nothing to build a trusted chain from - trust only the pinned cert.
+			tlsConfig.InsecureSkipVerify = true
+		}
+	}
+
+	return &http.Client{
+		Transport: &http.Transport{TLSClientConfig: tlsConfig},
+	}, nil
+}
+
+// checkCertPin reports an error unless the first presented certificate's
+// SHA-256 fingerprint matches wantHex (lowercase hex, no separators).
+func checkCertPin(rawCerts [][]byte, wantHex string) error {
+	if len(rawCerts) == 0 {
+		return fmt.Errorf("no certificate presented")
+	}
+
+	sum := sha256.Sum256(rawCerts[0])
+	if got := hex.EncodeToString(sum[:]); got != wantHex {
+		return fmt.Errorf("certificate pin mismatch: got %s, want %s", got, wantHex)
+	}
+
+	return nil
+}
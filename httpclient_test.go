@@ -0,0 +1,72 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadAPIKey(t *testing.T) {
+	t.Run("parses key and secret", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "apikey.txt")
+		writeFile(t, path, "key = abc123\nsecret = def456\n")
+
+		key, secret, err := loadAPIKey(path)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if key != "abc123" || secret != "def456" {
+			t.Fatalf("got key=%q secret=%q", key, secret)
+		}
+	})
+
+	t.Run("missing secret is an error", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "apikey.txt")
+		writeFile(t, path, "key = abc123\n")
+
+		if _, _, err := loadAPIKey(path); err == nil {
+			t.Fatalf("expected an error for a missing secret")
+		}
+	})
+
+	t.Run("missing file is an error", func(t *testing.T) {
+		if _, _, err := loadAPIKey(filepath.Join(t.TempDir(), "does-not-exist.txt")); err == nil {
+			t.Fatalf("expected an error for a missing file")
+		}
+	})
+}
+
+func TestCheckCertPin(t *testing.T) {
+	cert := []byte("pretend this is a DER-encoded certificate")
+	sum := sha256.Sum256(cert)
+	fingerprint := hex.EncodeToString(sum[:])
+
+	t.Run("matching fingerprint passes", func(t *testing.T) {
+		if err := checkCertPin([][]byte{cert}, fingerprint); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("mismatched fingerprint is rejected", func(t *testing.T) {
+		if err := checkCertPin([][]byte{cert}, "0000000000000000000000000000000000000000000000000000000000000000"); err == nil {
+			t.Fatalf("expected a pin mismatch error")
+		}
+	})
+
+	t.Run("no certificate presented is rejected", func(t *testing.T) {
+		if err := checkCertPin(nil, fingerprint); err == nil {
+			t.Fatalf("expected an error when no certificate is presented")
+		}
+	})
+}
+
+func writeFile(t *testing.T, path string, contents string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatalf("writing %s: %v", path, err)
+	}
+}
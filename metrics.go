@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	peerUpGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "wireguard_peer_up",
+		Help: "Whether a peer is currently enabled as the active peer in its failover group (1) or not (0).",
+	}, []string{"server", "peer"})
+
+	lastCheckTimestamp = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "wireguard_last_check_timestamp_seconds",
+		Help: "Unix timestamp of the last successfully completed check cycle.",
+	})
+
+	handshakeAgeSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "wireguard_peer_handshake_age_seconds",
+		Help:    "Age of a peer's last WireGuard handshake at the time it was checked.",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 12),
+	}, []string{"peer"})
+
+	apiCallsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "opnsense_api_calls_total",
+		Help: "OPNsense API calls made, by HTTP method and outcome.",
+	}, []string{"method", "status"})
+)
+
+func init() {
+	prometheus.MustRegister(peerUpGauge, lastCheckTimestamp, handshakeAgeSeconds, apiCallsTotal)
+}
+
+// recordAPICall tracks an OPNsense API call outcome. status is one of "ok",
+// "failed" (non-200 response) or "error" (the request itself failed).
+func recordAPICall(method string, status string) {
+	apiCallsTotal.WithLabelValues(method, status).Inc()
+}
+
+// recordHandshakeAge tracks how stale a peer's handshake was at check time.
+// A negative seconds value (no handshake yet) is not recorded.
+func recordHandshakeAge(peer string, seconds float64) {
+	if seconds < 0 {
+		return
+	}
+	handshakeAgeSeconds.WithLabelValues(peer).Observe(seconds)
+}
+
+func recordPeerUp(server string, peer string, up bool) {
+	value := 0.0
+	if up {
+		value = 1
+	}
+	peerUpGauge.WithLabelValues(server, peer).Set(value)
+}
+
+func metricsHandler() http.Handler {
+	return promhttp.Handler()
+}
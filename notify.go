@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/smtp"
+	"text/template"
+	"time"
+)
+
+const (
+	// defaultWebhookTemplate pipes every field through the "json" func so
+	// values containing quotes, backslashes or newlines (e.g. an OPNsense
+	// error response embedded in event.Error) still produce valid JSON,
+	// rather than being interpolated as raw strings.
+	defaultWebhookTemplate = `{"peer":{{.Peer | json}},"server":{{.Server | json}},"endpoint":{{.Endpoint | json}},"previous_state":{{.PreviousState | json}},"new_state":{{.NewState | json}},"timestamp":{{.Timestamp.Format "2006-01-02T15:04:05Z07:00" | json}},"error":{{.Error | json}}}`
+	defaultChatTemplate    = `WireGuard peer {{.Peer}} ({{.Server}}) went {{.PreviousState}} -> {{.NewState}} at {{.Timestamp.Format "15:04:05"}}{{if .Error}} (error: {{.Error}}){{end}}`
+)
+
+// templateFuncs is available to every notification template. json marshals
+// its argument with encoding/json, so a template can safely embed an
+// arbitrary string (quotes, backslashes, newlines and all) inside a JSON
+// document instead of interpolating it as a raw string.
+var templateFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	},
+}
+
+// NotificationConfig is one configured destination to notify on a peer state
+// change. Type selects the dispatch method; Template overrides the default
+// payload for that type.
+type NotificationConfig struct {
+	Type     string // "webhook", "slack", "discord", "matrix" or "smtp"
+	URL      string
+	Template string
+	SMTP     SMTPConfig
+}
+
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	From     string
+	To       []string
+	Username string
+	Password string
+}
+
+// NotificationEvent carries everything a notification template might want to
+// reference about a single peer state transition.
+type NotificationEvent struct {
+	Peer          string
+	Server        string
+	Endpoint      string
+	PreviousState string
+	NewState      string
+	Timestamp     time.Time
+	Error         string
+}
+
+func upDownLabel(up bool) string {
+	if up {
+		return "up"
+	}
+	return "down"
+}
+
+// notifyStateChange fires every configured notification target for a single
+// peer transition. Failures are logged, not returned, so one broken
+// destination can't stop the check cycle or the other destinations.
+func notifyStateChange(targets []NotificationConfig, event NotificationEvent) {
+	for _, target := range targets {
+		if err := dispatchNotification(target, event); err != nil {
+			slog.Warn("notification failed", "type", target.Type, "peer", event.Peer, "err", err)
+		}
+	}
+}
+
+func dispatchNotification(target NotificationConfig, event NotificationEvent) error {
+	switch target.Type {
+	case "webhook":
+		return sendWebhook(target, event)
+	case "slack":
+		return sendChatWebhook(target, event, "text")
+	case "discord":
+		return sendChatWebhook(target, event, "content")
+	case "matrix":
+		return sendChatWebhook(target, event, "body")
+	case "smtp":
+		return sendEmail(target, event)
+	default:
+		return fmt.Errorf("unknown notification type %q", target.Type)
+	}
+}
+
+func renderTemplate(tmplText string, event NotificationEvent) (string, error) {
+	tmpl, err := template.New("notification").Funcs(templateFuncs).Parse(tmplText)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, event); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+// sendWebhook POSTs the rendered template directly as the request body, so
+// Template is expected to produce a complete JSON document.
+func sendWebhook(target NotificationConfig, event NotificationEvent) error {
+	tmplText := target.Template
+	if tmplText == "" {
+		tmplText = defaultWebhookTemplate
+	}
+
+	payload, err := renderTemplate(tmplText, event)
+	if err != nil {
+		return err
+	}
+
+	return postJSON(target.URL, []byte(payload))
+}
+
+// sendChatWebhook renders Template as a plain text message and wraps it in
+// the {field: message} envelope the target chat webhook expects, e.g.
+// {"text": ...} for Slack, {"content": ...} for Discord.
+func sendChatWebhook(target NotificationConfig, event NotificationEvent, field string) error {
+	tmplText := target.Template
+	if tmplText == "" {
+		tmplText = defaultChatTemplate
+	}
+
+	message, err := renderTemplate(tmplText, event)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(map[string]string{field: message})
+	if err != nil {
+		return err
+	}
+
+	return postJSON(target.URL, body)
+}
+
+func postJSON(url string, body []byte) error {
+	resp, err := http.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("notification endpoint returned %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+func sendEmail(target NotificationConfig, event NotificationEvent) error {
+	tmplText := target.Template
+	if tmplText == "" {
+		tmplText = defaultChatTemplate
+	}
+
+	message, err := renderTemplate(tmplText, event)
+	if err != nil {
+		return err
+	}
+
+	subject := fmt.Sprintf("WireGuard peer %s: %s -> %s", event.Peer, event.PreviousState, event.NewState)
+	msg := []byte(fmt.Sprintf("Subject: %s\r\n\r\n%s\r\n", subject, message))
+
+	var auth smtp.Auth
+	if target.SMTP.Username != "" {
+		auth = smtp.PlainAuth("", target.SMTP.Username, target.SMTP.Password, target.SMTP.Host)
+	}
+
+	addr := fmt.Sprintf("%s:%d", target.SMTP.Host, target.SMTP.Port)
+	return smtp.SendMail(addr, auth, target.SMTP.From, target.SMTP.To, msg)
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestDefaultWebhookTemplateEscapesJSON(t *testing.T) {
+	event := NotificationEvent{
+		Peer:          `wan1"); DROP`,
+		Server:        "office",
+		Endpoint:      "203.0.113.1",
+		PreviousState: "up",
+		NewState:      "down",
+		Timestamp:     time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+		Error:         "setClient for peer wan1 failed: {\"message\": \"bad request\"}\nwith a trailing newline",
+	}
+
+	rendered, err := renderTemplate(defaultWebhookTemplate, event)
+	if err != nil {
+		t.Fatalf("rendering template: %v", err)
+	}
+
+	var decoded map[string]string
+	if err := json.Unmarshal([]byte(rendered), &decoded); err != nil {
+		t.Fatalf("rendered webhook body is not valid JSON: %v\nbody: %s", err, rendered)
+	}
+
+	if decoded["error"] != event.Error {
+		t.Fatalf("got error field %q, want %q", decoded["error"], event.Error)
+	}
+	if decoded["peer"] != event.Peer {
+		t.Fatalf("got peer field %q, want %q", decoded["peer"], event.Peer)
+	}
+}
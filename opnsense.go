@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+)
+
+type PeerResp struct {
+	Rows     []PeerConfig `json:"rows"`
+	RowCount int          `json:"rowCount"`
+	Total    int          `json:"total"`
+	Current  int          `json:"current"`
+}
+
+type PeerConfig struct {
+	Uuid          string `json:"uuid"`
+	Enabled       string `json:"enabled"`
+	Name          string `json:"name"`
+	Pubkey        string `json:"pubkey"`
+	Psk           string `json:"psk"`
+	Tunneladdress string `json:"tunneladdress"`
+	Serveraddress string `json:"serveraddress"`
+	Serverport    string `json:"serverport"`
+	Endpoint      string `json:"endpoint"`
+	Keepalive     string `json:"keepalive"`
+	Servers       string `json:"servers"`
+}
+
+type ServerDetails struct {
+	Rows []ServerDetail `json:"rows"`
+}
+
+type ServerDetail struct {
+	Uuid string `json:"uuid"`
+	Name string `json:"name"`
+}
+
+func getPeers(client *http.Client, auth string, url string) (string, error) {
+	const getClientsPath string = "/api/wireguard/client/searchClient"
+
+	getClientsURL := fmt.Sprintf("%s%s", url, getClientsPath)
+
+	req, err := http.NewRequest("GET", getClientsURL, nil)
+	if err != nil {
+		return "", err
+	}
+	// Set Authorization header
+	req.Header.Add("Authorization", "Basic "+auth)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	// Read the response body and convert it to string
+	resBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	return string(resBody), nil
+}
+
+func getWantedPeers(peersString string, searchString string) ([]PeerConfig, error) {
+	allPeersResp := PeerResp{}
+	if err := json.Unmarshal([]byte(peersString), &allPeersResp); err != nil {
+		return nil, err
+	}
+
+	peersWanted := []PeerConfig{}
+	for _, v := range allPeersResp.Rows {
+		if v.Servers == searchString {
+			peersWanted = append(peersWanted, v)
+		}
+	}
+
+	return peersWanted, nil
+}
+
+func setPeer(client *http.Client, enablePeer bool, auth string, url string, peer PeerConfig, servers ServerDetails) error {
+	const setClientPath string = "/api/wireguard/client/setClient"
+
+	setClientURL := fmt.Sprintf("%s%s", url, setClientPath+"/"+peer.Uuid)
+
+	var enabled string
+	if enablePeer {
+		enabled = "1"
+	} else {
+		enabled = "0"
+	}
+
+	// When setting peer the "servers" parameter needs to be the UUID of the server
+	var serversUuid string
+	for _, server := range servers.Rows {
+		if peer.Servers == server.Name {
+			serversUuid = server.Uuid
+			break
+		}
+	}
+
+	type setPeerClient struct {
+		Enabled       string `json:"enabled"`
+		Name          string `json:"name"`
+		Pubkey        string `json:"pubkey"`
+		Psk           string `json:"psk"`
+		Tunneladdress string `json:"tunneladdress"`
+		Serveraddress string `json:"serveraddress"`
+		Serverport    string `json:"serverport"`
+		Servers       string `json:"servers"`
+		Keepalive     string `json:"keepalive"`
+	}
+
+	settings := setPeerClient{
+		Enabled:       enabled,
+		Name:          peer.Name,
+		Pubkey:        peer.Pubkey,
+		Psk:           peer.Psk,
+		Tunneladdress: peer.Tunneladdress,
+		Serveraddress: peer.Serveraddress,
+		Serverport:    peer.Serverport,
+		Servers:       serversUuid,
+		Keepalive:     peer.Keepalive,
+	}
+
+	body := struct {
+		Client setPeerClient `json:"client"`
+	}{
+		Client: settings,
+	}
+
+	marshalledBody, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	res, code, err := makeRequest(client, "POST", setClientURL, auth, bytes.NewReader(marshalledBody))
+	if err != nil {
+		return err
+	}
+
+	if code != 200 {
+		return fmt.Errorf("setClient for peer %s failed: %s", peer.Name, res)
+	}
+
+	slog.Info("peer state applied", "peer", peer.Name, "enabled", enablePeer)
+	return nil
+}
+
+func makeRequest(client *http.Client, requestType string, url string, auth string, body io.Reader) ([]byte, int, error) {
+	req, err := http.NewRequest(requestType, url, body)
+	if err != nil {
+		recordAPICall(requestType, "error")
+		return nil, 0, err
+	}
+
+	req.Header.Add("Authorization", "Basic "+auth)
+	if requestType == "POST" && body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		recordAPICall(requestType, "error")
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	resBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		recordAPICall(requestType, "error")
+		return nil, 0, err
+	}
+
+	if resp.StatusCode != 200 {
+		recordAPICall(requestType, "failed")
+		return resBody, resp.StatusCode, fmt.Errorf("FAIL.\n\n\tReason: %d \n\tRequest Type: %s\n\tRequest made to: %s", resp.StatusCode, requestType, url)
+	}
+
+	recordAPICall(requestType, "ok")
+	return resBody, resp.StatusCode, nil
+}
+
+func getServerDetails(client *http.Client, auth string, url string) (ServerDetails, error) {
+	const getServerDetailsPath string = "/api/wireguard/client/list_servers"
+	getServerDetailsUrl := fmt.Sprintf("%s%s", url, getServerDetailsPath)
+
+	serverDetailsBody, code, err := makeRequest(client, "GET", getServerDetailsUrl, auth, nil)
+	if err != nil {
+		return ServerDetails{}, err
+	}
+	if code != 200 {
+		return ServerDetails{}, fmt.Errorf("error getting server details: status %d", code)
+	}
+
+	serverDetailsData := ServerDetails{}
+	if err := json.Unmarshal(serverDetailsBody, &serverDetailsData); err != nil {
+		return ServerDetails{}, err
+	}
+
+	return serverDetailsData, nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"time"
+)
+
+// defaultStateFile is used when Config.StateFile is unset.
+const defaultStateFile = "state.json"
+
+// PeerState tracks the hysteresis counters and last-applied enabled value for
+// a single peer, keyed by its OPNsense uuid, across runs.
+type PeerState struct {
+	LastObservedUp     bool      `json:"lastObservedUp"`
+	LastAppliedEnabled bool      `json:"lastAppliedEnabled"`
+	ConsecutiveUp      int       `json:"consecutiveUp"`
+	ConsecutiveDown    int       `json:"consecutiveDown"`
+	LastChangeTime     time.Time `json:"lastChangeTime"`
+}
+
+type StateStore struct {
+	Peers map[string]*PeerState `json:"peers"`
+}
+
+func loadState(path string) (*StateStore, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &StateStore{Peers: map[string]*PeerState{}}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	store := &StateStore{}
+	if err := json.Unmarshal(data, store); err != nil {
+		return nil, err
+	}
+	if store.Peers == nil {
+		store.Peers = map[string]*PeerState{}
+	}
+
+	return store, nil
+}
+
+func (s *StateStore) save(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, 0o600)
+}
+
+// peer returns the state for uuid, creating it if this is the first time it's
+// been seen.
+func (s *StateStore) peer(uuid string) *PeerState {
+	ps, ok := s.Peers[uuid]
+	if !ok {
+		ps = &PeerState{}
+		s.Peers[uuid] = ps
+	}
+
+	return ps
+}
+
+// observe feeds a raw liveness probe result into the peer's hysteresis
+// counters and returns the debounced up/down status that should actually be
+// acted on. requiredUp/requiredDown are how many consecutive matching probes
+// are needed before the status flips, and minDwell is the minimum time that
+// must have passed since the last flip before another is allowed.
+func (ps *PeerState) observe(rawUp bool, requiredUp int, requiredDown int, minDwell time.Duration, now time.Time) bool {
+	if rawUp {
+		ps.ConsecutiveUp++
+		ps.ConsecutiveDown = 0
+	} else {
+		ps.ConsecutiveDown++
+		ps.ConsecutiveUp = 0
+	}
+
+	if requiredUp < 1 {
+		requiredUp = 1
+	}
+	if requiredDown < 1 {
+		requiredDown = 1
+	}
+
+	dwellElapsed := ps.LastChangeTime.IsZero() || now.Sub(ps.LastChangeTime) >= minDwell
+
+	switch {
+	case !ps.LastObservedUp && rawUp && ps.ConsecutiveUp >= requiredUp && dwellElapsed:
+		ps.LastObservedUp = true
+		ps.LastChangeTime = now
+	case ps.LastObservedUp && !rawUp && ps.ConsecutiveDown >= requiredDown && dwellElapsed:
+		ps.LastObservedUp = false
+		ps.LastChangeTime = now
+	}
+
+	return ps.LastObservedUp
+}
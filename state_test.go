@@ -0,0 +1,86 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPeerStateObserve(t *testing.T) {
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("requires N consecutive ups before enabling", func(t *testing.T) {
+		ps := &PeerState{}
+
+		if up := ps.observe(true, 3, 3, 0, base); up {
+			t.Fatalf("expected still down after 1st up probe, got up")
+		}
+		if up := ps.observe(true, 3, 3, 0, base); up {
+			t.Fatalf("expected still down after 2nd up probe, got up")
+		}
+		if up := ps.observe(true, 3, 3, 0, base); !up {
+			t.Fatalf("expected up after 3rd consecutive up probe, got down")
+		}
+	})
+
+	t.Run("requires M consecutive downs before disabling", func(t *testing.T) {
+		ps := &PeerState{LastObservedUp: true}
+
+		if up := ps.observe(false, 2, 2, 0, base); !up {
+			t.Fatalf("expected still up after 1st down probe, got down")
+		}
+		if up := ps.observe(false, 2, 2, 0, base); up {
+			t.Fatalf("expected down after 2nd consecutive down probe, got up")
+		}
+	})
+
+	t.Run("a single opposite probe resets the streak", func(t *testing.T) {
+		ps := &PeerState{}
+
+		ps.observe(true, 3, 3, 0, base)
+		ps.observe(true, 3, 3, 0, base)
+		ps.observe(false, 3, 3, 0, base) // resets consecutiveUp to 0
+		if up := ps.observe(true, 3, 3, 0, base); up {
+			t.Fatalf("expected down, only 1 consecutive up since the reset")
+		}
+	})
+
+	t.Run("requiredUp/requiredDown default to 1 when unset", func(t *testing.T) {
+		ps := &PeerState{}
+
+		if up := ps.observe(true, 0, 0, 0, base); !up {
+			t.Fatalf("expected immediate flip to up with requiredUp=0 (defaults to 1)")
+		}
+		if up := ps.observe(false, 0, 0, 0, base); up {
+			t.Fatalf("expected immediate flip to down with requiredDown=0 (defaults to 1)")
+		}
+	})
+
+	t.Run("flapping within the dwell window does not flip state", func(t *testing.T) {
+		ps := &PeerState{}
+
+		// First transition to up at t=base.
+		if up := ps.observe(true, 1, 1, time.Minute, base); !up {
+			t.Fatalf("expected up on first probe")
+		}
+
+		// A down probe well within the dwell window must not flip it back down,
+		// even though requiredDown (1) is satisfied.
+		flapTime := base.Add(10 * time.Second)
+		if up := ps.observe(false, 1, 1, time.Minute, flapTime); !up {
+			t.Fatalf("expected state to stay up during dwell window, flapped down")
+		}
+
+		// Once the dwell window has elapsed, a down probe is allowed to flip it.
+		afterDwell := base.Add(time.Minute + time.Second)
+		if up := ps.observe(false, 1, 1, time.Minute, afterDwell); up {
+			t.Fatalf("expected state to flip down once dwell window elapsed")
+		}
+	})
+
+	t.Run("zero value last change time never blocks the first flip", func(t *testing.T) {
+		ps := &PeerState{}
+		if up := ps.observe(true, 1, 1, time.Hour, base); !up {
+			t.Fatalf("expected first-ever observation to flip despite a long dwell window")
+		}
+	})
+}
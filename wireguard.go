@@ -0,0 +1,97 @@
+package main
+
+import (
+	"log/slog"
+	"time"
+
+	"golang.zx2c4.com/wireguard/wgctrl"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// orderPeersByPriority sorts peers into the order given by priority (a list of
+// peer Names), appending any peers not mentioned in priority at the end so
+// they're still considered, just last. If priority is empty, peers is
+// returned unchanged.
+func orderPeersByPriority(peers []PeerConfig, priority []string) []PeerConfig {
+	if len(priority) == 0 {
+		return peers
+	}
+
+	ordered := make([]PeerConfig, 0, len(peers))
+	used := make(map[string]bool)
+
+	for _, name := range priority {
+		for _, p := range peers {
+			if p.Name == name && !used[p.Uuid] {
+				ordered = append(ordered, p)
+				used[p.Uuid] = true
+				break
+			}
+		}
+	}
+
+	for _, p := range peers {
+		if !used[p.Uuid] {
+			ordered = append(ordered, p)
+		}
+	}
+
+	return ordered
+}
+
+// selectActivePeer walks peers in priority order and returns the first one
+// whose (debounced) status in upByUUID is up. found is false if none of the
+// peers are up.
+func selectActivePeer(peers []PeerConfig, priority []string, upByUUID map[string]bool) (peer PeerConfig, found bool) {
+	for _, p := range orderPeersByPriority(peers, priority) {
+		if upByUUID[p.Uuid] {
+			return p, true
+		}
+	}
+
+	return PeerConfig{}, false
+}
+
+// isPeerUp determines liveness from the WireGuard interface itself rather than
+// probing the endpoint over TCP (which the peer, being a UDP WireGuard
+// endpoint, would never actually answer on). A peer is considered up if the
+// local interface has completed a handshake with it within handshakeWindow.
+func isPeerUp(wgClient *wgctrl.Client, ifaceName string, handshakeWindow time.Duration, peer PeerConfig) bool {
+	device, err := wgClient.Device(ifaceName)
+	if err != nil {
+		slog.Warn("unable to read WireGuard interface", "interface", ifaceName, "err", err)
+		return false
+	}
+
+	pubKey, err := wgtypes.ParseKey(peer.Pubkey)
+	if err != nil {
+		slog.Warn("invalid pubkey for peer", "peer", peer.Name, "err", err)
+		return false
+	}
+
+	for _, wgPeer := range device.Peers {
+		if wgPeer.PublicKey != pubKey {
+			continue
+		}
+
+		if wgPeer.LastHandshakeTime.IsZero() {
+			slog.Info("peer has never completed a handshake", "peer", peer.Name)
+			recordHandshakeAge(peer.Name, -1)
+			return false
+		}
+
+		since := time.Since(wgPeer.LastHandshakeTime)
+		recordHandshakeAge(peer.Name, since.Seconds())
+
+		if since > handshakeWindow {
+			slog.Info("peer handshake is stale", "peer", peer.Name, "since", since)
+			return false
+		}
+
+		slog.Info("peer is up", "peer", peer.Name, "since", since)
+		return true
+	}
+
+	slog.Warn("peer not found on interface", "interface", ifaceName, "peer", peer.Name)
+	return false
+}
@@ -0,0 +1,93 @@
+package main
+
+import "testing"
+
+func peerNames(peers []PeerConfig) []string {
+	names := make([]string, len(peers))
+	for i, p := range peers {
+		names[i] = p.Name
+	}
+	return names
+}
+
+func TestOrderPeersByPriority(t *testing.T) {
+	peers := []PeerConfig{
+		{Uuid: "1", Name: "primary"},
+		{Uuid: "2", Name: "secondary"},
+		{Uuid: "3", Name: "tertiary"},
+	}
+
+	tests := []struct {
+		name     string
+		priority []string
+		want     []string
+	}{
+		{
+			name:     "empty priority returns peers unchanged",
+			priority: nil,
+			want:     []string{"primary", "secondary", "tertiary"},
+		},
+		{
+			name:     "priority reorders peers",
+			priority: []string{"tertiary", "primary", "secondary"},
+			want:     []string{"tertiary", "primary", "secondary"},
+		},
+		{
+			name:     "peers not named in priority are appended at the end",
+			priority: []string{"secondary"},
+			want:     []string{"secondary", "primary", "tertiary"},
+		},
+		{
+			name:     "priority names not present in peers are ignored",
+			priority: []string{"does-not-exist", "tertiary"},
+			want:     []string{"tertiary", "primary", "secondary"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := peerNames(orderPeersByPriority(peers, tt.priority))
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("got %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestSelectActivePeer(t *testing.T) {
+	peers := []PeerConfig{
+		{Uuid: "1", Name: "primary"},
+		{Uuid: "2", Name: "secondary"},
+		{Uuid: "3", Name: "tertiary"},
+	}
+	priority := []string{"primary", "secondary", "tertiary"}
+
+	t.Run("picks the highest priority peer that is up", func(t *testing.T) {
+		up := map[string]bool{"1": false, "2": true, "3": true}
+		peer, found := selectActivePeer(peers, priority, up)
+		if !found || peer.Name != "secondary" {
+			t.Fatalf("got %+v found=%v, want secondary found=true", peer, found)
+		}
+	})
+
+	t.Run("falls back down the priority list", func(t *testing.T) {
+		up := map[string]bool{"1": false, "2": false, "3": true}
+		peer, found := selectActivePeer(peers, priority, up)
+		if !found || peer.Name != "tertiary" {
+			t.Fatalf("got %+v found=%v, want tertiary found=true", peer, found)
+		}
+	})
+
+	t.Run("found is false when nothing is up", func(t *testing.T) {
+		up := map[string]bool{"1": false, "2": false, "3": false}
+		_, found := selectActivePeer(peers, priority, up)
+		if found {
+			t.Fatalf("expected found=false when no peer is up")
+		}
+	})
+}